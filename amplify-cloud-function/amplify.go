@@ -1,12 +1,10 @@
 package amplify
 
 import (
-	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"time"
@@ -18,7 +16,8 @@ import (
 )
 
 var (
-	driveService *drive.Service
+	driveService     *drive.Service
+	allowedMimeTypes map[string]bool
 )
 
 func init() {
@@ -31,6 +30,7 @@ func init() {
 		log.Fatalf("Unable to retrieve Drive client: %v", err)
 	}
 	driveService = service
+	allowedMimeTypes = ParseAllowedMimeTypes(os.Getenv("ALLOWED_MIME_TYPES"))
 }
 
 type PubSubMessage struct {
@@ -44,8 +44,13 @@ func processFile(fileID string) error {
 	return nil
 }
 
-func moveFile(fileID, folderID, driveID string) error {
-	file, err := driveService.Files.Get(fileID).SupportsAllDrives(driveID != "").Fields("parents").Do()
+func moveFile(ctx context.Context, fileID, folderID, driveID string) error {
+	var file *drive.File
+	err := DrivePacer.Call(ctx, "Files.Get", func() (bool, error) {
+		var err error
+		file, err = driveService.Files.Get(fileID).SupportsAllDrives(driveID != "").Fields("parents").Do()
+		return ShouldRetryDriveError(err), err
+	})
 	if err != nil {
 		return fmt.Errorf("unable to retrieve file %v: %v", fileID, err)
 	}
@@ -54,7 +59,10 @@ func moveFile(fileID, folderID, driveID string) error {
 		return fmt.Errorf("file %v does not have any parents", fileID)
 	}
 	previousParents := file.Parents
-	_, err = driveService.Files.Update(fileID, nil).SupportsAllDrives(driveID != "").RemoveParents(previousParents[0]).AddParents(folderID).Do()
+	err = DrivePacer.Call(ctx, "Files.Update", func() (bool, error) {
+		_, err := driveService.Files.Update(fileID, nil).SupportsAllDrives(driveID != "").RemoveParents(previousParents[0]).AddParents(folderID).Do()
+		return ShouldRetryDriveError(err), err
+	})
 	if err != nil {
 		return fmt.Errorf("unable to move file %v to folder %v: %v", fileID, folderID, err)
 	}
@@ -65,7 +73,17 @@ func moveFile(fileID, folderID, driveID string) error {
 func listFilesInInputFolder(ctx context.Context, folderID, driveID string) error {
 	log.Printf("Listing files in the input folder: %s", folderID)
 	query := fmt.Sprintf("'%s' in parents and trashed = false", folderID)
-	fileList, err := driveService.Files.List().Q(query).SupportsAllDrives(driveID != "").Fields("files(id, name, parents)").Do()
+	call := driveService.Files.List().Q(query).SupportsAllDrives(driveID != "").Fields("files(id, name, parents)")
+	if driveID != "" {
+		call = call.IncludeItemsFromAllDrives(true).Corpora("drive").DriveId(driveID)
+	}
+
+	var fileList *drive.FileList
+	err := DrivePacer.Call(ctx, "Files.List", func() (bool, error) {
+		var err error
+		fileList, err = call.Do()
+		return ShouldRetryDriveError(err), err
+	})
 	if err != nil {
 		log.Printf("Failed to list files: %v", err)
 		return fmt.Errorf("Failed to list files: %v", err)
@@ -83,23 +101,28 @@ func listFilesInInputFolder(ctx context.Context, folderID, driveID string) error
 func AmplifyFunction(ctx context.Context, e event.Event) error {
 	log.Printf("Event data: %s", string(e.Data()))
 
-	var m struct {
-		Message struct {
-			Data string `json:"data"`
-		} `json:"message"`
-	}
-	if err := json.Unmarshal(e.Data(), &m); err != nil {
+	var envelope PushEnvelope
+	if err := json.Unmarshal(e.Data(), &envelope); err != nil {
 		log.Printf("Failed to unmarshal event data: %v", err)
 		return fmt.Errorf("Failed to unmarshal event data: %v", err)
 	}
 
 	// Decode the Base64-encoded data
-	decodedData, err := base64.StdEncoding.DecodeString(m.Message.Data)
+	decodedData, err := base64.StdEncoding.DecodeString(envelope.Message.Data)
 	if err != nil {
 		log.Printf("Failed to decode data: %v", err)
 		return fmt.Errorf("Failed to decode data: %v", err)
 	}
 
+	// Eventarc's CloudEvent delivery is already authenticated at the
+	// infrastructure level, so we only need idempotency and dead-letter
+	// handling here, not a second OIDC check.
+	return HandlePush(ctx, DefaultSeenStore, false, "", envelope.Message.MessageID, envelope.Message.Attributes, decodedData, func(decodedData []byte) error {
+		return processAmplifyMessage(ctx, decodedData)
+	})
+}
+
+func processAmplifyMessage(ctx context.Context, decodedData []byte) error {
 	var msg PubSubMessage
 	if err := json.Unmarshal(decodedData, &msg); err != nil {
 		log.Printf("Failed to unmarshal decoded data: %v", err)
@@ -128,12 +151,22 @@ func AmplifyFunction(ctx context.Context, e event.Event) error {
 	}
 
 	log.Printf("Retrieving metadata for file: %s", fileID)
-	file, err := driveService.Files.Get(fileID).SupportsAllDrives(driveID != "").Fields("id, name, parents").Do()
+	var file *drive.File
+	err := DrivePacer.Call(ctx, "Files.Get", func() (bool, error) {
+		var err error
+		file, err = driveService.Files.Get(fileID).SupportsAllDrives(driveID != "").Fields("id, name, parents, mimeType, size").Do()
+		return ShouldRetryDriveError(err), err
+	})
 	if err != nil {
 		log.Printf("Failed to get file metadata: %v", err)
 		return fmt.Errorf("Failed to get file metadata: %v", err)
 	}
-	log.Printf("File metadata: ID=%s, Name=%s, Parents=%v", file.Id, file.Name, file.Parents)
+	log.Printf("File metadata: ID=%s, Name=%s, Parents=%v, MimeType=%s", file.Id, file.Name, file.Parents, file.MimeType)
+
+	if !MimeAllowed(allowedMimeTypes, file.MimeType) {
+		log.Printf("File %s (%s) does not match ALLOWED_MIME_TYPES, ignoring.", file.Name, file.MimeType)
+		return nil
+	}
 
 	inInputFolder := false
 	for _, parent := range file.Parents {
@@ -149,7 +182,7 @@ func AmplifyFunction(ctx context.Context, e event.Event) error {
 	}
 
 	log.Printf("Moving file %s to temp folder %s", fileID, tempFolderID)
-	if err := moveFile(fileID, tempFolderID, driveID); err != nil {
+	if err := moveFile(ctx, fileID, tempFolderID, driveID); err != nil {
 		log.Printf("Failed to move file to temp folder: %v", err)
 		return fmt.Errorf("Failed to move file to temp folder: %v", err)
 	}
@@ -160,28 +193,10 @@ func AmplifyFunction(ctx context.Context, e event.Event) error {
 		return fmt.Errorf("Failed to process file: %v", err)
 	}
 
-	log.Printf("Downloading file %s", fileID)
-	res, err := driveService.Files.Get(fileID).SupportsAllDrives(driveID != "").Download()
-	if err != nil {
-		log.Printf("Failed to download file: %v", err)
-		return fmt.Errorf("Failed to download file: %v", err)
-	}
-	defer res.Body.Close()
-	fileData, err := io.ReadAll(res.Body)
-	if err != nil {
-		log.Printf("Failed to read file data: %v", err)
-		return fmt.Errorf("Failed to read file data: %v", err)
-	}
-
-	log.Printf("Creating file %s in output folder %s", file.Name, outputFolderID)
-	fileMetadata := &drive.File{
-		Name:    file.Name,
-		Parents: []string{outputFolderID},
-	}
-	_, err = driveService.Files.Create(fileMetadata).Media(bytes.NewReader(fileData)).SupportsAllDrives(driveID != "").Do()
-	if err != nil {
-		log.Printf("Failed to create file in output folder: %v", err)
-		return fmt.Errorf("Failed to create file in output folder: %v", err)
+	log.Printf("Copying file %s to output folder %s", fileID, outputFolderID)
+	if _, err := CopyPreservingMetadata(ctx, driveID, file.Id, outputFolderID, CopyOptionsFromEnv()); err != nil {
+		log.Printf("Failed to copy file to output folder: %v", err)
+		return fmt.Errorf("Failed to copy file to output folder: %v", err)
 	}
 
 	log.Printf("File %s processed successfully", fileID)
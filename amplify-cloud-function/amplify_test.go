@@ -0,0 +1,87 @@
+package amplify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+// TestListFilesInInputFolderThreadsSharedDriveParams asserts that, when
+// DRIVE_ID (driveID here) is set, listFilesInInputFolder's Files.List call
+// actually sends the shared-drive query parameters Drive requires to see
+// files living in a shared drive, not just a personal one.
+func TestListFilesInInputFolderThreadsSharedDriveParams(t *testing.T) {
+	var gotQuery url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"files": []}`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	service, err := drive.NewService(ctx, option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("drive.NewService: %v", err)
+	}
+	prevService := driveService
+	driveService = service
+	defer func() { driveService = prevService }()
+
+	if err := listFilesInInputFolder(ctx, "folder-1", "drive-1"); err != nil {
+		t.Fatalf("listFilesInInputFolder: %v", err)
+	}
+
+	want := map[string]string{
+		"supportsAllDrives":         "true",
+		"includeItemsFromAllDrives": "true",
+		"corpora":                   "drive",
+		"driveId":                   "drive-1",
+	}
+	for key, wantValue := range want {
+		if got := gotQuery.Get(key); got != wantValue {
+			t.Errorf("query param %q = %q, want %q (full query: %v)", key, got, wantValue, gotQuery)
+		}
+	}
+}
+
+// TestListFilesInInputFolderOmitsSharedDriveParamsWithoutDriveID asserts
+// the personal-drive path doesn't send shared-drive-only params that would
+// be meaningless (or rejected) without a driveId.
+func TestListFilesInInputFolderOmitsSharedDriveParamsWithoutDriveID(t *testing.T) {
+	var gotQuery url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"files": []}`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	service, err := drive.NewService(ctx, option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("drive.NewService: %v", err)
+	}
+	prevService := driveService
+	driveService = service
+	defer func() { driveService = prevService }()
+
+	if err := listFilesInInputFolder(ctx, "folder-1", ""); err != nil {
+		t.Fatalf("listFilesInInputFolder: %v", err)
+	}
+
+	if got := gotQuery.Get("supportsAllDrives"); got != "false" {
+		t.Errorf("supportsAllDrives = %q, want %q", got, "false")
+	}
+	if gotQuery.Get("driveId") != "" {
+		t.Errorf("driveId = %q, want empty when no DRIVE_ID is set", gotQuery.Get("driveId"))
+	}
+	if gotQuery.Get("corpora") != "" {
+		t.Errorf("corpora = %q, want empty when no DRIVE_ID is set", gotQuery.Get("corpora"))
+	}
+}
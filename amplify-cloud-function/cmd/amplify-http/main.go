@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/kenjinezumi/amplify-backend/amplify-cloud-function"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+var (
+	driveService     *drive.Service
+	allowedMimeTypes map[string]bool
+)
+
+// init initializes the Google Drive service using Application Default Credentials.
+func init() {
+	ctx := context.Background()
+
+	// Use Application Default Credentials
+	service, err := drive.NewService(ctx, option.WithScopes(drive.DriveScope))
+	if err != nil {
+		log.Fatalf("Unable to retrieve Drive client: %v", err)
+	}
+	driveService = service
+	allowedMimeTypes = amplify.ParseAllowedMimeTypes(os.Getenv("ALLOWED_MIME_TYPES"))
+}
+
+// PushedFile is the decoded payload of a Pub/Sub message identifying
+// which Drive file to process.
+type PushedFile struct {
+	FileName   string `json:"fileName"`
+	ResourceID string `json:"resourceId"`
+}
+
+// processFile simulates file processing by sleeping for 2 seconds.
+func processFile(fileID string) error {
+	// Simulate processing time
+	time.Sleep(2 * time.Second)
+	// Log the processing step
+	log.Printf("Processing file %s", fileID)
+	return nil
+}
+
+// moveFile moves a file to a specified folder in Google Drive. driveID,
+// when set, scopes the calls to a shared drive.
+func moveFile(ctx context.Context, fileID, folderID, driveID string) error {
+	// Retrieve the file metadata
+	var file *drive.File
+	err := amplify.DrivePacer.Call(ctx, "Files.Get", func() (bool, error) {
+		var err error
+		file, err = driveService.Files.Get(fileID).SupportsAllDrives(driveID != "").Fields("parents").Do()
+		return amplify.ShouldRetryDriveError(err), err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to retrieve file %v: %v", fileID, err)
+	}
+
+	// Remove the file from its current parents
+	previousParents := file.Parents
+	err = amplify.DrivePacer.Call(ctx, "Files.Update", func() (bool, error) {
+		_, err := driveService.Files.Update(fileID, nil).SupportsAllDrives(driveID != "").RemoveParents(previousParents[0]).AddParents(folderID).Do()
+		return amplify.ShouldRetryDriveError(err), err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to move file %v to folder %v: %v", fileID, folderID, err)
+	}
+
+	return nil
+}
+
+// handleRequest handles the incoming HTTP request triggered by a Pub/Sub
+// push subscription: it verifies the push token, decodes the standard
+// Pub/Sub envelope, and dedupes/dead-letters through amplify.HandlePush.
+func handleRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var envelope amplify.PushEnvelope
+	if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	decodedData, err := base64.StdEncoding.DecodeString(envelope.Message.Data)
+	if err != nil {
+		http.Error(w, "Bad Request: invalid message data", http.StatusBadRequest)
+		return
+	}
+
+	err = amplify.HandlePush(ctx, amplify.DefaultSeenStore, true, r.Header.Get("Authorization"), envelope.Message.MessageID, envelope.Message.Attributes, decodedData, func(decodedData []byte) error {
+		return processPushedFile(ctx, decodedData)
+	})
+	if err != nil {
+		log.Printf("Failed to process message: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to process message: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintln(w, "File processed successfully")
+}
+
+func processPushedFile(ctx context.Context, decodedData []byte) error {
+	var msg PushedFile
+	if err := json.Unmarshal(decodedData, &msg); err != nil {
+		return fmt.Errorf("unable to unmarshal message data: %v", err)
+	}
+
+	fileID := msg.ResourceID
+	tempFolderID := os.Getenv("TEMP_FOLDER_ID")     // Set these as environment variables
+	outputFolderID := os.Getenv("OUTPUT_FOLDER_ID") // Set these as environment variables
+	driveID := os.Getenv("DRIVE_ID")
+
+	if tempFolderID == "" || outputFolderID == "" {
+		return fmt.Errorf("Folder IDs are not set")
+	}
+
+	var file *drive.File
+	err := amplify.DrivePacer.Call(ctx, "Files.Get", func() (bool, error) {
+		var err error
+		file, err = driveService.Files.Get(fileID).SupportsAllDrives(driveID != "").Fields("mimeType, name").Do()
+		return amplify.ShouldRetryDriveError(err), err
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to get file metadata: %v", err)
+	}
+	if !amplify.MimeAllowed(allowedMimeTypes, file.MimeType) {
+		log.Printf("File %s (%s) does not match ALLOWED_MIME_TYPES, ignoring.", file.Name, file.MimeType)
+		return nil
+	}
+
+	// Move to temporary folder
+	if err := moveFile(ctx, fileID, tempFolderID, driveID); err != nil {
+		return fmt.Errorf("Failed to move file to temp folder: %v", err)
+	}
+
+	// Process the file
+	if err := processFile(fileID); err != nil {
+		return fmt.Errorf("Failed to process file: %v", err)
+	}
+
+	// Copy to output folder, preserving metadata that a plain move would lose
+	if _, err := amplify.CopyPreservingMetadata(ctx, driveID, fileID, outputFolderID, amplify.CopyOptionsFromEnv()); err != nil {
+		return fmt.Errorf("Failed to copy file to output folder: %v", err)
+	}
+
+	log.Printf("File %s processed successfully", fileID)
+	return nil
+}
+
+// main is the entry point for the plain Cloud Run HTTP service.
+func main() {
+	http.HandleFunc("/", handleRequest)
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	log.Printf("Listening on port %s", port)
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), nil))
+}
@@ -0,0 +1,160 @@
+package amplify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// copyMetadataFields is the field mask used to read back everything
+// CopyPreservingMetadata might need to carry over to the copy.
+const copyMetadataFields = "id,name,mimeType,size,modifiedTime,description,appProperties,properties,permissions(role,type,emailAddress,domain)"
+
+// nativeExportMimeTypes are the Drive mimeTypes that have no binary
+// content of their own, so they must be duplicated with Files.Copy
+// rather than streamed through copyFileStreaming.
+var nativeExportMimeTypes = map[string]bool{
+	"application/vnd.google-apps.document":     true,
+	"application/vnd.google-apps.spreadsheet":  true,
+	"application/vnd.google-apps.presentation": true,
+	"application/vnd.google-apps.drawing":      true,
+}
+
+// isNativeExportType reports whether mimeType is a native Google Doc/
+// Sheet/Slide/Drawing that has to be copied rather than downloaded.
+func isNativeExportType(mimeType string) bool {
+	return nativeExportMimeTypes[mimeType]
+}
+
+// CopyOptions controls which source-file metadata CopyPreservingMetadata
+// carries over to the copy, since neither Files.Copy nor a fresh
+// Files.Create preserves all of it by default.
+type CopyOptions struct {
+	PreservePermissions   bool
+	PreserveModifiedTime  bool
+	PreserveAppProperties bool
+}
+
+// CopyOptionsFromEnv reads PRESERVE_PERMISSIONS, PRESERVE_MODIFIED_TIME,
+// and PRESERVE_APP_PROPERTIES ("true" to enable each).
+func CopyOptionsFromEnv() CopyOptions {
+	return CopyOptions{
+		PreservePermissions:   os.Getenv("PRESERVE_PERMISSIONS") == "true",
+		PreserveModifiedTime:  os.Getenv("PRESERVE_MODIFIED_TIME") == "true",
+		PreserveAppProperties: os.Getenv("PRESERVE_APP_PROPERTIES") == "true",
+	}
+}
+
+// CopyPreservingMetadata copies srcID into dstFolderID without losing the
+// metadata a plain download-then-Create (or a same-type Files.Copy) would
+// otherwise drop. Native Google Docs/Sheets/Slides/Drawings are duplicated
+// with Files.Copy by default, which Drive can do natively, preserving
+// full native fidelity; if EXPORT_EXTENSIONS is set, they're exported to
+// that format instead (e.g. docx/xlsx/pptx) via copyNativeFileExport.
+// Everything else streams through copyFileStreaming, which can carry over
+// ModifiedTime and appProperties/properties directly in the create
+// metadata. Whichever path is taken, if opts.PreservePermissions is set,
+// non-owner permissions are reapplied afterwards via Permissions.Create
+// since neither Copy, Create, nor Export inherits them from the source file.
+func CopyPreservingMetadata(ctx context.Context, driveID, srcID, dstFolderID string, opts CopyOptions) (*drive.File, error) {
+	full, err := getCopyMetadata(ctx, driveID, srcID)
+	if err != nil {
+		return nil, err
+	}
+
+	var copied *drive.File
+	switch {
+	case isNativeExportType(full.MimeType) && exportExtensionsConfigured():
+		copied, err = copyNativeFileExport(ctx, driveID, full, dstFolderID)
+	case isNativeExportType(full.MimeType):
+		copied, err = copyNativeFileDirect(ctx, driveID, full, dstFolderID, opts)
+	default:
+		copied, err = copyFileStreaming(ctx, driveID, full, dstFolderID, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if copied == nil {
+		// copyNativeFileExport skips files with no matching EXPORT_EXTENSIONS entry.
+		return nil, nil
+	}
+
+	if opts.PreservePermissions {
+		reapplyPermissions(ctx, driveID, full, copied.Id)
+	}
+	return copied, nil
+}
+
+// getCopyMetadata fetches the fields CopyPreservingMetadata needs to
+// decide how to copy srcID and what to carry over.
+func getCopyMetadata(ctx context.Context, driveID, srcID string) (*drive.File, error) {
+	var full *drive.File
+	err := DrivePacer.Call(ctx, "Files.Get(copy metadata)", func() (bool, error) {
+		var err error
+		full, err = driveService.Files.Get(srcID).SupportsAllDrives(driveID != "").Fields(copyMetadataFields).Do()
+		return ShouldRetryDriveError(err), err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve copy metadata for %v: %v", srcID, err)
+	}
+	return full, nil
+}
+
+// copyNativeFileDirect duplicates a native Google Doc/Sheet/Slide/Drawing
+// with Files.Copy, which preserves full native fidelity (unlike exporting
+// it to another format). KeepRevisionForever pins the copy's initial
+// revision so it isn't garbage-collected, and IgnoreDefaultVisibility
+// keeps the copy private until permissions are explicitly reapplied.
+func copyNativeFileDirect(ctx context.Context, driveID string, full *drive.File, dstFolderID string, opts CopyOptions) (*drive.File, error) {
+	copyMetadata := &drive.File{
+		Name:    full.Name,
+		Parents: []string{dstFolderID},
+	}
+	if opts.PreserveAppProperties {
+		copyMetadata.AppProperties = full.AppProperties
+		copyMetadata.Properties = full.Properties
+	}
+
+	var copied *drive.File
+	err := DrivePacer.Call(ctx, "Files.Copy", func() (bool, error) {
+		var err error
+		copied, err = driveService.Files.Copy(full.Id, copyMetadata).
+			SupportsAllDrives(driveID != "").
+			KeepRevisionForever(true).
+			IgnoreDefaultVisibility(true).
+			Do()
+		return ShouldRetryDriveError(err), err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to copy file %v to folder %v: %v", full.Id, dstFolderID, err)
+	}
+	return copied, nil
+}
+
+// reapplyPermissions re-grants every non-owner permission on full to
+// fileID. Failures are logged rather than returned, since the copy itself
+// already succeeded and a missing permission shouldn't fail the whole
+// operation.
+func reapplyPermissions(ctx context.Context, driveID string, full *drive.File, fileID string) {
+	for _, p := range full.Permissions {
+		if p.Role == "owner" {
+			continue
+		}
+		perm := &drive.Permission{
+			Role:         p.Role,
+			Type:         p.Type,
+			EmailAddress: p.EmailAddress,
+			Domain:       p.Domain,
+		}
+		err := DrivePacer.Call(ctx, "Permissions.Create", func() (bool, error) {
+			_, err := driveService.Permissions.Create(fileID, perm).SupportsAllDrives(driveID != "").Do()
+			return ShouldRetryDriveError(err), err
+		})
+		if err != nil {
+			log.Printf("Unable to reapply permission (role=%s type=%s) to %s: %v", p.Role, p.Type, fileID, err)
+		}
+	}
+}
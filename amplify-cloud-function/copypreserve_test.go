@@ -0,0 +1,30 @@
+package amplify
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCopyOptionsFromEnv(t *testing.T) {
+	for _, key := range []string{"PRESERVE_PERMISSIONS", "PRESERVE_MODIFIED_TIME", "PRESERVE_APP_PROPERTIES"} {
+		os.Unsetenv(key)
+	}
+
+	if opts := CopyOptionsFromEnv(); opts != (CopyOptions{}) {
+		t.Errorf("CopyOptionsFromEnv() with no env set = %+v, want zero value", opts)
+	}
+
+	os.Setenv("PRESERVE_PERMISSIONS", "true")
+	os.Setenv("PRESERVE_MODIFIED_TIME", "true")
+	os.Setenv("PRESERVE_APP_PROPERTIES", "true")
+	defer func() {
+		os.Unsetenv("PRESERVE_PERMISSIONS")
+		os.Unsetenv("PRESERVE_MODIFIED_TIME")
+		os.Unsetenv("PRESERVE_APP_PROPERTIES")
+	}()
+
+	want := CopyOptions{PreservePermissions: true, PreserveModifiedTime: true, PreserveAppProperties: true}
+	if opts := CopyOptionsFromEnv(); opts != want {
+		t.Errorf("CopyOptionsFromEnv() = %+v, want %+v", opts, want)
+	}
+}
@@ -0,0 +1,171 @@
+package amplify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+func TestEnvSizeMB(t *testing.T) {
+	const name = "TEST_ENV_SIZE_MB"
+	os.Unsetenv(name)
+	if got := envSizeMB(name, 8); got != 8 {
+		t.Errorf("unset env: got %d, want default 8", got)
+	}
+
+	os.Setenv(name, "16")
+	defer os.Unsetenv(name)
+	if got := envSizeMB(name, 8); got != 16 {
+		t.Errorf("set env: got %d, want 16", got)
+	}
+
+	os.Setenv(name, "not-a-number")
+	if got := envSizeMB(name, 8); got != 8 {
+		t.Errorf("invalid env: got %d, want default 8", got)
+	}
+}
+
+// fakeDriveServer serves just enough of the Drive v3 REST surface for
+// copyFileStreaming: a download response for Files.Get?alt=media, and
+// either a single-shot multipart upload or a resumable session for
+// Files.Create, recording the bytes it actually received.
+func fakeDriveServer(t *testing.T, content []byte, createdID string) (*httptest.Server, func() []byte) {
+	t.Helper()
+	var received []byte
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet:
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(content)
+
+		case r.Method == http.MethodPost && r.URL.Query().Get("uploadType") == "resumable":
+			w.Header().Set("Location", server.URL+"/upload-session")
+			w.WriteHeader(http.StatusOK)
+
+		case r.Method == http.MethodPost && r.URL.Path == "/upload-session":
+			chunk, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Errorf("reading resumable chunk: %v", err)
+			}
+			received = append(received, chunk...)
+			if len(received) < len(content) {
+				w.Header().Set("X-Http-Status-Code-Override", "308")
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"id": %q}`, createdID)
+
+		case r.Method == http.MethodPost:
+			mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+				http.Error(w, "expected multipart upload", http.StatusBadRequest)
+				return
+			}
+			reader := multipart.NewReader(r.Body, params["boundary"])
+			// First part is the JSON metadata, second is the file content.
+			if _, err := reader.NextPart(); err != nil {
+				t.Errorf("reading metadata part: %v", err)
+			}
+			contentPart, err := reader.NextPart()
+			if err != nil {
+				t.Errorf("reading content part: %v", err)
+			} else {
+				received, err = io.ReadAll(contentPart)
+				if err != nil {
+					t.Errorf("reading content part body: %v", err)
+				}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"id": %q}`, createdID)
+
+		default:
+			t.Logf("unexpected request: %s %s", r.Method, r.URL.String())
+			http.Error(w, "unexpected request", http.StatusNotImplemented)
+		}
+	}))
+	return server, func() []byte { return received }
+}
+
+func TestCopyFileStreamingSingleShot(t *testing.T) {
+	content := []byte("hello drive")
+	server, uploaded := fakeDriveServer(t, content, "created-1")
+	defer server.Close()
+
+	ctx := context.Background()
+	service, err := drive.NewService(ctx, option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("drive.NewService: %v", err)
+	}
+
+	prevService := driveService
+	driveService = service
+	defer func() { driveService = prevService }()
+
+	os.Setenv("UPLOAD_CUTOFF_MB", "8")
+	defer os.Unsetenv("UPLOAD_CUTOFF_MB")
+
+	srcFile := &drive.File{Id: "src-1", Name: "doc.txt", MimeType: "text/plain", Size: int64(len(content))}
+	created, err := copyFileStreaming(ctx, "", srcFile, "dest-folder", CopyOptions{})
+	if err != nil {
+		t.Fatalf("copyFileStreaming: %v", err)
+	}
+	if created.Id != "created-1" {
+		t.Errorf("created.Id = %q, want %q", created.Id, "created-1")
+	}
+	if got := string(uploaded()); got != string(content) {
+		t.Errorf("uploaded content = %q, want %q", got, content)
+	}
+}
+
+func TestCopyFileStreamingResumable(t *testing.T) {
+	// Big enough to clear a 1MB cutoff, so this exercises the resumable
+	// Media(..., googleapi.ChunkSize(...)) path rather than a single-shot upload.
+	content := make([]byte, 2*1024*1024)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	server, uploaded := fakeDriveServer(t, content, "created-2")
+	defer server.Close()
+
+	ctx := context.Background()
+	service, err := drive.NewService(ctx, option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("drive.NewService: %v", err)
+	}
+
+	prevService := driveService
+	driveService = service
+	defer func() { driveService = prevService }()
+
+	os.Setenv("UPLOAD_CUTOFF_MB", "1")
+	os.Setenv("CHUNK_SIZE_MB", "1")
+	defer func() {
+		os.Unsetenv("UPLOAD_CUTOFF_MB")
+		os.Unsetenv("CHUNK_SIZE_MB")
+	}()
+
+	srcFile := &drive.File{Id: "src-2", Name: "big.bin", MimeType: "application/octet-stream", Size: int64(len(content))}
+	created, err := copyFileStreaming(ctx, "", srcFile, "dest-folder", CopyOptions{})
+	if err != nil {
+		t.Fatalf("copyFileStreaming (resumable path): %v", err)
+	}
+	if created.Id != "created-2" {
+		t.Errorf("created.Id = %q, want %q", created.Id, "created-2")
+	}
+	if got := uploaded(); len(got) != len(content) {
+		t.Errorf("uploaded %d bytes, want %d", len(got), len(content))
+	}
+}
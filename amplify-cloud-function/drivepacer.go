@@ -0,0 +1,14 @@
+package amplify
+
+import "github.com/kenjinezumi/amplify-backend/drivepacer"
+
+// DrivePacer is the shared backoff pacer for all Drive API calls made by
+// this package.
+var DrivePacer = drivepacer.New()
+
+// ShouldRetryDriveError reports whether err looks like a transient Drive
+// API failure worth retrying: HTTP 429/500/502/503/504, or a 403 whose
+// reason is a rate-limit or backend error.
+func ShouldRetryDriveError(err error) bool {
+	return drivepacer.ShouldRetry(err)
+}
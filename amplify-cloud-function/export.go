@@ -0,0 +1,121 @@
+package amplify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// exportExtensionsConfigured reports whether the operator has opted into
+// exporting native Google Docs/Sheets/Slides/Drawings by setting
+// EXPORT_EXTENSIONS. Without it, CopyPreservingMetadata defaults to
+// copyNativeFileDirect (Files.Copy) for full native-format fidelity.
+func exportExtensionsConfigured() bool {
+	return os.Getenv("EXPORT_EXTENSIONS") != ""
+}
+
+// exportMimeByExtension maps, per native source mimeType, an export file
+// extension to the export mimeType Drive should produce for it.
+var exportMimeByExtension = map[string]map[string]string{
+	"application/vnd.google-apps.document": {
+		"docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"pdf":  "application/pdf",
+		"odt":  "application/vnd.oasis.opendocument.text",
+	},
+	"application/vnd.google-apps.spreadsheet": {
+		"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"pdf":  "application/pdf",
+		"csv":  "text/csv",
+	},
+	"application/vnd.google-apps.presentation": {
+		"pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+		"pdf":  "application/pdf",
+	},
+	"application/vnd.google-apps.drawing": {
+		"svg": "image/svg+xml",
+		"png": "image/png",
+		"pdf": "application/pdf",
+	},
+}
+
+// exportExtensions returns the ordered extension preference list from
+// EXPORT_EXTENSIONS.
+func exportExtensions() []string {
+	var extensions []string
+	for _, part := range strings.Split(os.Getenv("EXPORT_EXTENSIONS"), ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			extensions = append(extensions, part)
+		}
+	}
+	return extensions
+}
+
+// chooseExportMime picks the first extension, in EXPORT_EXTENSIONS
+// preference order, that mimeType can be exported to, and returns that
+// extension along with the Drive export mimeType to request.
+func chooseExportMime(mimeType string) (extension, exportMime string, ok bool) {
+	byExtension, known := exportMimeByExtension[mimeType]
+	if !known {
+		return "", "", false
+	}
+	for _, ext := range exportExtensions() {
+		if mime, ok := byExtension[ext]; ok {
+			return ext, mime, true
+		}
+	}
+	return "", "", false
+}
+
+// copyNativeFileExport exports srcFile (a native Google Doc/Sheet/Slide/
+// Drawing) to the best available extension in EXPORT_EXTENSIONS and
+// writes the result into destFolderID as name+"."+extension. A file with
+// no matching export extension is skipped, not failed: it returns a nil
+// file and a nil error, and the caller should just log and move on.
+func copyNativeFileExport(ctx context.Context, driveID string, srcFile *drive.File, destFolderID string) (*drive.File, error) {
+	extension, exportMime, ok := chooseExportMime(srcFile.MimeType)
+	if !ok {
+		log.Printf("File %s (%s) has no matching EXPORT_EXTENSIONS entry, skipping", srcFile.Name, srcFile.MimeType)
+		return nil, nil
+	}
+
+	var data []byte
+	err := DrivePacer.Call(ctx, "Files.Export", func() (bool, error) {
+		res, err := driveService.Files.Export(srcFile.Id, exportMime).Download()
+		if ShouldRetryDriveError(err) {
+			return true, err
+		}
+		if err != nil {
+			return false, err
+		}
+		defer res.Body.Close()
+		data, err = io.ReadAll(res.Body)
+		return false, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to export file %v as %v: %v", srcFile.Id, exportMime, err)
+	}
+
+	metadata := &drive.File{
+		Name:    srcFile.Name + "." + extension,
+		Parents: []string{destFolderID},
+	}
+
+	var created *drive.File
+	err = DrivePacer.Call(ctx, "Files.Create(export)", func() (bool, error) {
+		var err error
+		created, err = driveService.Files.Create(metadata).Media(bytes.NewReader(data)).SupportsAllDrives(driveID != "").Do()
+		return ShouldRetryDriveError(err), err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create exported file in folder %v: %v", destFolderID, err)
+	}
+	log.Printf("Exported %s as %s to folder %s", srcFile.Name, metadata.Name, destFolderID)
+	return created, nil
+}
@@ -0,0 +1,43 @@
+package amplify
+
+import (
+	"os"
+	"testing"
+)
+
+func TestChooseExportMime(t *testing.T) {
+	os.Setenv("EXPORT_EXTENSIONS", "docx,xlsx,pptx,svg")
+	defer os.Unsetenv("EXPORT_EXTENSIONS")
+
+	ext, mime, ok := chooseExportMime("application/vnd.google-apps.document")
+	if !ok || ext != "docx" || mime != "application/vnd.openxmlformats-officedocument.wordprocessingml.document" {
+		t.Errorf("got (%q, %q, %v), want (docx, docx mimeType, true)", ext, mime, ok)
+	}
+
+	if _, _, ok := chooseExportMime("application/pdf"); ok {
+		t.Error("expected no export mapping for a non-native mimeType")
+	}
+}
+
+func TestChooseExportMimeRespectsPreferenceOrder(t *testing.T) {
+	os.Setenv("EXPORT_EXTENSIONS", "pdf,docx")
+	defer os.Unsetenv("EXPORT_EXTENSIONS")
+
+	ext, mime, ok := chooseExportMime("application/vnd.google-apps.document")
+	if !ok || ext != "pdf" || mime != "application/pdf" {
+		t.Errorf("got (%q, %q, %v), want (pdf, application/pdf, true)", ext, mime, ok)
+	}
+}
+
+func TestExportExtensionsConfigured(t *testing.T) {
+	os.Unsetenv("EXPORT_EXTENSIONS")
+	if exportExtensionsConfigured() {
+		t.Error("expected exportExtensionsConfigured() to be false when EXPORT_EXTENSIONS is unset")
+	}
+
+	os.Setenv("EXPORT_EXTENSIONS", "docx")
+	defer os.Unsetenv("EXPORT_EXTENSIONS")
+	if !exportExtensionsConfigured() {
+		t.Error("expected exportExtensionsConfigured() to be true once EXPORT_EXTENSIONS is set")
+	}
+}
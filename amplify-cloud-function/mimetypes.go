@@ -0,0 +1,44 @@
+package amplify
+
+import "strings"
+
+// mimeAliases maps short, human-friendly names accepted in
+// ALLOWED_MIME_TYPES to the Drive mimeType they stand for.
+var mimeAliases = map[string]string{
+	"doc":  "application/msword",
+	"docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"pdf":  "application/pdf",
+	"gdoc": "application/vnd.google-apps.document",
+}
+
+// ParseAllowedMimeTypes parses a comma-separated ALLOWED_MIME_TYPES value
+// (aliases or raw mimeTypes) into a set. An empty value means "allow
+// everything", preserving the previous unfiltered behavior.
+func ParseAllowedMimeTypes(raw string) map[string]bool {
+	if raw == "" {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if mimeType, ok := mimeAliases[part]; ok {
+			set[mimeType] = true
+			continue
+		}
+		set[part] = true
+	}
+	return set
+}
+
+// MimeAllowed reports whether mimeType passes the ALLOWED_MIME_TYPES
+// filter. A nil/empty filter allows everything.
+func MimeAllowed(allowed map[string]bool, mimeType string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	return allowed[mimeType]
+}
@@ -0,0 +1,27 @@
+package amplify
+
+import "testing"
+
+func TestParseAllowedMimeTypes(t *testing.T) {
+	if set := ParseAllowedMimeTypes(""); set != nil {
+		t.Fatalf("expected nil set for empty input, got %v", set)
+	}
+
+	set := ParseAllowedMimeTypes("docx,pdf")
+	if !set["application/vnd.openxmlformats-officedocument.wordprocessingml.document"] {
+		t.Error("expected docx alias to resolve")
+	}
+	if !set["application/pdf"] {
+		t.Error("expected pdf alias to resolve")
+	}
+}
+
+func TestMimeAllowed(t *testing.T) {
+	if !MimeAllowed(nil, "anything/at-all") {
+		t.Error("nil filter should allow everything")
+	}
+	set := ParseAllowedMimeTypes("pdf")
+	if MimeAllowed(set, "image/png") {
+		t.Error("expected image/png to be rejected")
+	}
+}
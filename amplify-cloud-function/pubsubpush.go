@@ -0,0 +1,189 @@
+package amplify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/pubsub"
+	"google.golang.org/api/idtoken"
+)
+
+// PushEnvelope is the standard Pub/Sub push subscription JSON body,
+// delivered either as a raw HTTP push request or wrapped in a CloudEvent.
+type PushEnvelope struct {
+	Message struct {
+		Data        string            `json:"data"`
+		MessageID   string            `json:"messageId"`
+		Attributes  map[string]string `json:"attributes"`
+		PublishTime string            `json:"publishTime"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// SeenStore tracks Pub/Sub messageIds that have already been successfully
+// processed, so at-least-once redelivery doesn't reprocess a message and
+// double-publish an output file. A failed attempt must not be marked seen,
+// or a redelivered message would be mistaken for a duplicate and dropped
+// instead of retried. Implementations must be safe for concurrent use; a
+// production deployment should back this with Firestore or Memorystore.
+type SeenStore interface {
+	// Seen reports whether messageID has already been recorded as
+	// successfully processed.
+	Seen(ctx context.Context, messageID string) (bool, error)
+	// MarkSeen records messageID as successfully processed.
+	MarkSeen(ctx context.Context, messageID string) error
+}
+
+// memorySeenStore is an in-memory SeenStore for tests and single-instance
+// deployments where a shared store isn't wired up.
+type memorySeenStore struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newMemorySeenStore() *memorySeenStore {
+	return &memorySeenStore{seen: make(map[string]bool)}
+}
+
+func (s *memorySeenStore) Seen(ctx context.Context, messageID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seen[messageID], nil
+}
+
+func (s *memorySeenStore) MarkSeen(ctx context.Context, messageID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen[messageID] = true
+	return nil
+}
+
+var DefaultSeenStore SeenStore = newMemorySeenStore()
+
+// verifyPushToken validates the OIDC bearer token on a Pub/Sub push
+// request against PUSH_AUDIENCE and PUSH_SERVICE_ACCOUNT. If PUSH_AUDIENCE
+// is unset, verification is skipped (e.g. for local/dev runs).
+func verifyPushToken(ctx context.Context, authHeader string) error {
+	audience := os.Getenv("PUSH_AUDIENCE")
+	if audience == "" {
+		return nil
+	}
+
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+	if token == authHeader {
+		return fmt.Errorf("missing bearer token")
+	}
+
+	payload, err := idtoken.Validate(ctx, token, audience)
+	if err != nil {
+		return fmt.Errorf("invalid push token: %v", err)
+	}
+	if sa := os.Getenv("PUSH_SERVICE_ACCOUNT"); sa != "" && payload.Claims["email"] != sa {
+		return fmt.Errorf("unexpected push caller %v", payload.Claims["email"])
+	}
+	return nil
+}
+
+// deliveryAttempt parses the "deliveryAttempt" Pub/Sub attribute, which is
+// 1 on first delivery.
+func deliveryAttempt(attributes map[string]string) int {
+	attempt, err := strconv.Atoi(attributes["deliveryAttempt"])
+	if err != nil || attempt < 1 {
+		return 1
+	}
+	return attempt
+}
+
+// maxAttempts returns the MAX_ATTEMPTS threshold after which a
+// persistently failing message is dead-lettered instead of retried.
+func maxAttempts() int {
+	raw := os.Getenv("MAX_ATTEMPTS")
+	if raw == "" {
+		return 5
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 5
+	}
+	return n
+}
+
+// deadLetter republishes the original message to DEAD_LETTER_TOPIC with
+// the processing error attached as an attribute, so the push subscription
+// can ACK the original message instead of retrying it forever.
+func deadLetter(ctx context.Context, data []byte, attributes map[string]string, cause error) error {
+	topicID := os.Getenv("DEAD_LETTER_TOPIC")
+	if topicID == "" {
+		return fmt.Errorf("no DEAD_LETTER_TOPIC configured, cannot dead-letter: %v", cause)
+	}
+
+	client, err := pubsub.NewClient(ctx, os.Getenv("GOOGLE_CLOUD_PROJECT"))
+	if err != nil {
+		return fmt.Errorf("unable to create Pub/Sub client for dead-lettering: %v", err)
+	}
+	defer client.Close()
+
+	attrs := make(map[string]string, len(attributes)+1)
+	for k, v := range attributes {
+		attrs[k] = v
+	}
+	attrs["originalError"] = cause.Error()
+
+	result := client.Topic(topicID).Publish(ctx, &pubsub.Message{Data: data, Attributes: attrs})
+	if _, err := result.Get(ctx); err != nil {
+		return fmt.Errorf("unable to publish to dead-letter topic %v: %v", topicID, err)
+	}
+	log.Printf("Dead-lettered message to %s after repeated failure: %v", topicID, cause)
+	return nil
+}
+
+// HandlePush wraps a Pub/Sub push message with OIDC verification (when
+// verifyAuth is set), messageId-based idempotency, and dead-letter routing
+// once a message has failed MAX_ATTEMPTS times. process receives the
+// decoded message payload. The messageId is only recorded as seen once
+// process succeeds, so a failed attempt is retried instead of being
+// mistaken for an already-handled duplicate on redelivery.
+func HandlePush(ctx context.Context, store SeenStore, verifyAuth bool, authHeader, messageID string, attributes map[string]string, data []byte, process func([]byte) error) error {
+	if verifyAuth {
+		if err := verifyPushToken(ctx, authHeader); err != nil {
+			return fmt.Errorf("push authorization failed: %v", err)
+		}
+	}
+
+	if messageID != "" {
+		alreadySeen, err := store.Seen(ctx, messageID)
+		if err != nil {
+			log.Printf("Unable to check message idempotency for %s: %v", messageID, err)
+		} else if alreadySeen {
+			log.Printf("Message %s already processed, acknowledging duplicate delivery", messageID)
+			return nil
+		}
+	}
+
+	processErr := process(data)
+	if processErr == nil {
+		if messageID != "" {
+			if err := store.MarkSeen(ctx, messageID); err != nil {
+				log.Printf("Unable to record message %s as seen: %v", messageID, err)
+			}
+		}
+		return nil
+	}
+
+	attempt := deliveryAttempt(attributes)
+	if attempt < maxAttempts() {
+		return processErr
+	}
+
+	log.Printf("Message %s failed on delivery attempt %d (>= MAX_ATTEMPTS=%d), dead-lettering instead of retrying forever: %v", messageID, attempt, maxAttempts(), processErr)
+	if dlErr := deadLetter(ctx, data, attributes, processErr); dlErr != nil {
+		log.Printf("Failed to dead-letter message %s: %v", messageID, dlErr)
+		return processErr
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package amplify
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMemorySeenStoreDedupes(t *testing.T) {
+	store := newMemorySeenStore()
+	ctx := context.Background()
+
+	if seen, err := store.Seen(ctx, "msg-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if seen {
+		t.Error("Seen should report false before MarkSeen is called")
+	}
+
+	if err := store.MarkSeen(ctx, "msg-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if seen, err := store.Seen(ctx, "msg-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !seen {
+		t.Error("Seen should report true after MarkSeen")
+	}
+}
+
+func TestHandlePushSkipsDuplicateMessages(t *testing.T) {
+	store := newMemorySeenStore()
+	ctx := context.Background()
+	calls := 0
+	process := func([]byte) error {
+		calls++
+		return nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := HandlePush(ctx, store, false, "", "msg-1", nil, []byte("data"), process); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("expected process to run once for a duplicate delivery, ran %d times", calls)
+	}
+}
+
+func TestHandlePushRetriesAfterFailedAttempt(t *testing.T) {
+	store := newMemorySeenStore()
+	ctx := context.Background()
+	calls := 0
+	process := func([]byte) error {
+		calls++
+		if calls == 1 {
+			return errors.New("transient failure")
+		}
+		return nil
+	}
+
+	if err := HandlePush(ctx, store, false, "", "msg-1", nil, []byte("data"), process); err == nil {
+		t.Fatal("expected the first, failing attempt to return an error")
+	}
+	if err := HandlePush(ctx, store, false, "", "msg-1", nil, []byte("data"), process); err != nil {
+		t.Fatalf("expected the redelivered attempt to be retried, got error: %v", err)
+	}
+
+	if calls != 2 {
+		t.Errorf("expected process to run on both the failing and the redelivered attempt, ran %d times", calls)
+	}
+}
+
+func TestDeliveryAttemptDefaultsToOne(t *testing.T) {
+	if got := deliveryAttempt(nil); got != 1 {
+		t.Errorf("deliveryAttempt(nil) = %d, want 1", got)
+	}
+	if got := deliveryAttempt(map[string]string{"deliveryAttempt": "3"}); got != 3 {
+		t.Errorf("deliveryAttempt(3) = %d, want 3", got)
+	}
+}
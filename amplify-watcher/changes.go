@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/drive/v3"
+
+	"github.com/kenjinezumi/amplify-backend/drivepacer"
+)
+
+// driveCallPacer is the shared backoff pacer for all Drive API calls made
+// by this binary.
+var driveCallPacer = drivepacer.New()
+
+// ChannelState is the resumable state of a Drive changes watch: the page
+// token to resume listing from, and the push channel currently bound to
+// it. Persisting this across restarts means we never fall back to
+// replaying a fixed time window the way the old listFiles loop did.
+type ChannelState struct {
+	PageToken      string `json:"pageToken"`
+	ChannelID      string `json:"channelId"`
+	ResourceID     string `json:"resourceId"`
+	ExpirationUnix int64  `json:"expirationUnix"`
+}
+
+// loadChannelState reads the channel state from STATE_URI, supporting a
+// gs:// object path or a local file path. A missing object/file is not an
+// error: it just means we haven't started watching yet.
+func loadChannelState(ctx context.Context, stateURI string) (*ChannelState, error) {
+	data, err := readState(ctx, stateURI)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var state ChannelState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("unable to parse channel state from %v: %v", stateURI, err)
+	}
+	return &state, nil
+}
+
+// saveChannelState writes the channel state to STATE_URI, overwriting
+// whatever was there before.
+func saveChannelState(ctx context.Context, stateURI string, state *ChannelState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("unable to marshal channel state: %v", err)
+	}
+	if err := writeState(ctx, stateURI, data); err != nil {
+		return err
+	}
+	log.Printf("Saved channel state to %s: pageToken=%s channelId=%s", stateURI, state.PageToken, state.ChannelID)
+	return nil
+}
+
+func readState(ctx context.Context, stateURI string) ([]byte, error) {
+	bucket, object, isGCS := parseGCSURI(stateURI)
+	if !isGCS {
+		data, err := os.ReadFile(stateURI)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read state file %v: %v", stateURI, err)
+		}
+		return data, nil
+	}
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create storage client: %v", err)
+	}
+	defer client.Close()
+
+	r, err := client.Bucket(bucket).Object(object).NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read state object %v: %v", stateURI, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read state object %v: %v", stateURI, err)
+	}
+	return data, nil
+}
+
+func writeState(ctx context.Context, stateURI string, data []byte) error {
+	bucket, object, isGCS := parseGCSURI(stateURI)
+	if !isGCS {
+		if err := os.WriteFile(stateURI, data, 0644); err != nil {
+			return fmt.Errorf("unable to write state file %v: %v", stateURI, err)
+		}
+		return nil
+	}
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to create storage client: %v", err)
+	}
+	defer client.Close()
+
+	w := client.Bucket(bucket).Object(object).NewWriter(ctx)
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return fmt.Errorf("unable to write state object %v: %v", stateURI, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("unable to write state object %v: %v", stateURI, err)
+	}
+	return nil
+}
+
+func parseGCSURI(uri string) (bucket, object string, isGCS bool) {
+	const prefix = "gs://"
+	if !strings.HasPrefix(uri, prefix) {
+		return "", "", false
+	}
+	rest := strings.TrimPrefix(uri, prefix)
+	parts := strings.SplitN(rest, "/", 2)
+	if len(parts) != 2 {
+		return parts[0], "", true
+	}
+	return parts[0], parts[1], true
+}
+
+// startPageToken fetches a fresh Drive changes page token to begin
+// tracking from. driveID, when set, scopes the token to a shared drive.
+func startPageToken(ctx context.Context, driveService *drive.Service, driveID string) (string, error) {
+	call := driveService.Changes.GetStartPageToken().SupportsAllDrives(driveID != "")
+	if driveID != "" {
+		call = call.DriveId(driveID)
+	}
+	var token *drive.StartPageToken
+	err := driveCallPacer.Call(ctx, "Changes.GetStartPageToken", func() (bool, error) {
+		var err error
+		token, err = call.Do()
+		return drivepacer.ShouldRetry(err), err
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to get start page token: %v", err)
+	}
+	return token.StartPageToken, nil
+}
+
+// watchChanges registers a push notification channel for the changes feed
+// starting at pageToken. The channel expires after a few hours, so the
+// caller must re-watch before state.ExpirationUnix.
+func watchChanges(ctx context.Context, driveService *drive.Service, pageToken, channelID, webhookURL, topicID, driveID string) (*drive.Channel, error) {
+	channel := &drive.Channel{
+		Id:      channelID,
+		Type:    "web_hook",
+		Address: webhookURL,
+		Token:   topicID,
+	}
+	call := driveService.Changes.Watch(pageToken, channel).SupportsAllDrives(driveID != "")
+	var result *drive.Channel
+	err := driveCallPacer.Call(ctx, "Changes.Watch", func() (bool, error) {
+		var err error
+		result, err = call.Do()
+		return drivepacer.ShouldRetry(err), err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to watch changes from page token %v: %v", pageToken, err)
+	}
+	return result, nil
+}
+
+// folderChange describes a single Drive change that is relevant to the
+// watched folder, ready to publish.
+type folderChange struct {
+	FileID string
+	Name   string
+}
+
+// listChanges drains every page of changes since pageToken, reporting one
+// folderChange per changed file whose current parents include folderID
+// and whose mimeType passes allowedMimeTypes (removed files, files that
+// moved out of the folder, and disallowed mimeTypes are skipped), and
+// returns the page token to resume from next time.
+func listChanges(ctx context.Context, driveService *drive.Service, pageToken, folderID, driveID string, allowedMimeTypes map[string]bool, seen map[string]bool) (string, []folderChange, error) {
+	var relevant []folderChange
+
+	for {
+		call := driveService.Changes.List(pageToken).
+			SupportsAllDrives(driveID != "").
+			IncludeItemsFromAllDrives(driveID != "").
+			Fields("newStartPageToken, nextPageToken, changes(fileId, time, removed, file(id, name, mimeType, parents))")
+		if driveID != "" {
+			call = call.DriveId(driveID)
+		}
+		var changeList *drive.ChangeList
+		err := driveCallPacer.Call(ctx, "Changes.List", func() (bool, error) {
+			var err error
+			changeList, err = call.Do()
+			return drivepacer.ShouldRetry(err), err
+		})
+		if err != nil {
+			return pageToken, relevant, fmt.Errorf("unable to list changes from page token %v: %v", pageToken, err)
+		}
+
+		for _, change := range changeList.Changes {
+			changeID := change.FileId + "@" + change.Time
+			if seen[changeID] {
+				continue
+			}
+			seen[changeID] = true
+
+			if change.Removed || change.File == nil {
+				continue
+			}
+			if !hasParent(change.File.Parents, folderID) {
+				continue
+			}
+			if !mimeAllowed(allowedMimeTypes, change.File.MimeType) {
+				log.Printf("File %s (%s) does not match ALLOWED_MIME_TYPES, ignoring.", change.File.Name, change.File.MimeType)
+				continue
+			}
+			relevant = append(relevant, folderChange{FileID: change.File.Id, Name: change.File.Name})
+		}
+
+		if changeList.NewStartPageToken != "" {
+			return changeList.NewStartPageToken, relevant, nil
+		}
+		if changeList.NextPageToken == "" {
+			log.Printf("Change list returned neither a next nor a new start page token, stopping")
+			return pageToken, relevant, nil
+		}
+		pageToken = changeList.NextPageToken
+	}
+}
+
+func hasParent(parents []string, folderID string) bool {
+	for _, p := range parents {
+		if p == folderID {
+			return true
+		}
+	}
+	return false
+}
+
+// channelNeedsRenewal reports whether the watch channel is close enough to
+// expiring that it should be re-registered.
+func channelNeedsRenewal(expirationUnix int64) bool {
+	if expirationUnix == 0 {
+		return true
+	}
+	return time.Until(time.UnixMilli(expirationUnix)) < 10*time.Minute
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/pubsub"
@@ -16,12 +17,6 @@ import (
 	"google.golang.org/api/option"
 )
 
-type Notification struct {
-	Kind       string `json:"kind"`
-	ID         string `json:"id"`
-	ResourceID string `json:"resourceId"`
-}
-
 type FileInfo struct {
 	FileName   string `json:"fileName"`
 	ResourceID string `json:"resourceId"`
@@ -31,6 +26,17 @@ var (
 	pubsubClient *pubsub.Client
 	topic        *pubsub.Topic
 	webhookURL   string
+	topicID      string
+
+	stateURI string
+	folderID string
+	driveID  string
+
+	allowedMimeTypes map[string]bool
+
+	stateMu   sync.Mutex
+	channel   *ChannelState
+	seenSince = map[string]bool{}
 )
 
 func main() {
@@ -55,35 +61,23 @@ func main() {
 	log.Printf("Using service account: %s", credsFile)
 
 	// Get configuration from environment variables
-	folderID := os.Getenv("DRIVE_FOLDER_ID")
-	topicID := os.Getenv("PUBSUB_TOPIC")
+	folderID = os.Getenv("DRIVE_FOLDER_ID")
+	topicID = os.Getenv("PUBSUB_TOPIC")
 	webhookURL = os.Getenv("WEBHOOK_URL")
 	projectID := os.Getenv("PROJECT_ID")
+	stateURI = os.Getenv("STATE_URI")
+	driveID = os.Getenv("DRIVE_ID")
+	allowedMimeTypes = parseAllowedMimeTypes(os.Getenv("ALLOWED_MIME_TYPES"))
 
 	// Check if all required environment variables are set
 	if folderID == "" || topicID == "" || webhookURL == "" || projectID == "" {
 		log.Fatal("Environment variables DRIVE_FOLDER_ID, PUBSUB_TOPIC, WEBHOOK_URL, and PROJECT_ID must be set")
 	}
-
-	log.Printf("Environment variables:\nDRIVE_FOLDER_ID=%s\nPUBSUB_TOPIC=%s\nWEBHOOK_URL=%s\nPROJECT_ID=%s\n", folderID, topicID, webhookURL, projectID)
-
-	// Generate a unique channel ID
-	channelID := uuid.New().String()
-
-	// Create the watch request
-	watchRequest := &drive.Channel{
-		Id:      channelID,
-		Type:    "web_hook",
-		Address: webhookURL,
-		Token:   topicID,
+	if stateURI == "" {
+		log.Fatal("Environment variable STATE_URI must be set (a gs:// object path or a local file path)")
 	}
 
-	// Set up the watch on the folder
-	_, err = driveService.Files.Watch(folderID, watchRequest).Do()
-	if err != nil {
-		log.Fatalf("Unable to set up watch: %v. Please check if the folder ID is correct and the service account has access to the folder.", err)
-	}
-	log.Println("Watch set up successfully")
+	log.Printf("Environment variables:\nDRIVE_FOLDER_ID=%s\nPUBSUB_TOPIC=%s\nWEBHOOK_URL=%s\nPROJECT_ID=%s\nSTATE_URI=%s\nDRIVE_ID=%s\n", folderID, topicID, webhookURL, projectID, stateURI, driveID)
 
 	// Initialize Pub/Sub client
 	pubsubClient, err = pubsub.NewClient(ctx, projectID)
@@ -92,10 +86,36 @@ func main() {
 	}
 	topic = pubsubClient.Topic(topicID)
 
+	channel, err = loadChannelState(ctx, stateURI)
+	if err != nil {
+		log.Fatalf("Unable to load channel state: %v", err)
+	}
+	if channel == nil {
+		token, err := startPageToken(ctx, driveService, driveID)
+		if err != nil {
+			log.Fatalf("Unable to get start page token: %v", err)
+		}
+		channel = &ChannelState{PageToken: token}
+		log.Printf("No previous channel state found, starting from a fresh page token: %s", token)
+	}
+
+	if err := ensureWatch(ctx, driveService); err != nil {
+		log.Fatalf("Unable to set up changes watch: %v", err)
+	}
+	log.Println("Changes watch set up successfully")
+
+	// Periodically re-sync and renew the watch channel before it expires.
+	// This is the fallback path: even if a push notification is dropped,
+	// we never fall behind by more than this interval.
 	go func() {
 		for {
-			listFiles(ctx, driveService, folderID)
-			time.Sleep(5 * time.Second) // Wait for 5 seconds before listing files again
+			time.Sleep(60 * time.Second)
+			if err := syncChanges(ctx, driveService); err != nil {
+				log.Printf("Periodic change sync failed: %v", err)
+			}
+			if err := ensureWatch(ctx, driveService); err != nil {
+				log.Printf("Unable to renew changes watch: %v", err)
+			}
 		}
 	}()
 
@@ -103,11 +123,11 @@ func main() {
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		log.Println("Received request at /")
 
-		// Log headers and body for debugging
-		for name, values := range r.Header {
-			for _, value := range values {
-				log.Printf("Header: %s: %s", name, value)
-			}
+		resourceState := r.Header.Get("X-Goog-Resource-State")
+		if resourceState == "sync" {
+			log.Println("Received Drive sync handshake, acknowledging")
+			fmt.Fprintln(w, "ok")
+			return
 		}
 
 		body, err := ioutil.ReadAll(r.Body)
@@ -116,58 +136,14 @@ func main() {
 			http.Error(w, "Unable to read request body", http.StatusBadRequest)
 			return
 		}
+		log.Printf("Notification body: %s", string(body))
 
-		log.Printf("Request body: %s", string(body))
-
-		var notification Notification
-		if err := json.Unmarshal(body, &notification); err != nil {
-			log.Printf("Error parsing request body: %v", err)
-			http.Error(w, "Unable to parse request body", http.StatusBadRequest)
-			return
-		}
-
-		log.Printf("Received notification for resource ID: %s", notification.ResourceID)
-
-		// Retrieve the file metadata
-		file, err := driveService.Files.Get(notification.ResourceID).Fields("id, name, mimeType, modifiedTime").Do()
-		if err != nil {
-			log.Printf("Error retrieving file metadata: %v", err)
-			http.Error(w, "Unable to retrieve file metadata", http.StatusInternalServerError)
-			return
-		}
-
-		log.Printf("File metadata retrieved: ID=%s, Name=%s, MimeType=%s", file.Id, file.Name, file.MimeType)
-
-		// Check if the file is a Word document
-		if file.MimeType != "application/vnd.openxmlformats-officedocument.wordprocessingml.document" && file.MimeType != "application/msword" {
-			log.Printf("File %s is not a Word document, ignoring.", file.Name)
-			return
-		}
-
-		fileInfo := FileInfo{
-			FileName:   file.Name,
-			ResourceID: notification.ResourceID,
-		}
-
-		// Publish the file information to the Pub/Sub topic
-		fileInfoBytes, err := json.Marshal(fileInfo)
-		if err != nil {
-			log.Printf("Error marshaling file info: %v", err)
-			http.Error(w, "Unable to marshal file info", http.StatusInternalServerError)
+		if err := syncChanges(ctx, driveService); err != nil {
+			log.Printf("Failed to sync changes: %v", err)
+			http.Error(w, "Unable to sync changes", http.StatusInternalServerError)
 			return
 		}
 
-		result := topic.Publish(ctx, &pubsub.Message{
-			Data: fileInfoBytes,
-		})
-
-		// Block until the result is returned and log server-generated message IDs.
-		id, err := result.Get(ctx)
-		if err != nil {
-			log.Printf("Failed to publish message: %v", err)
-		}
-		log.Printf("Published message with ID: %s for file: %s", id, file.Name)
-
 		fmt.Fprintln(w, "Notification received and processed.")
 	})
 
@@ -186,61 +162,63 @@ func main() {
 	}
 }
 
-func listFiles(ctx context.Context, driveService *drive.Service, folderID string) {
-	// Get the list of files from Google Drive
-	files, err := driveService.Files.List().Q(fmt.Sprintf("'%s' in parents", folderID)).Fields("files(id, name, createdTime, modifiedTime, mimeType)").Do()
+// ensureWatch (re-)registers the changes push channel if we don't have one
+// yet or the current one is close to expiring, then persists the result.
+func ensureWatch(ctx context.Context, driveService *drive.Service) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	if !channelNeedsRenewal(channel.ExpirationUnix) {
+		return nil
+	}
+
+	channelID := uuid.New().String()
+	result, err := watchChanges(ctx, driveService, channel.PageToken, channelID, webhookURL, topicID, driveID)
 	if err != nil {
-		log.Printf("Error listing files: %v", err)
-		return
+		return err
 	}
 
-	// Log the list of files in the Drive folder
-	for _, file := range files.Files {
-		log.Printf("Scanning the drive.")
+	channel.ChannelID = result.Id
+	channel.ResourceID = result.ResourceId
+	channel.ExpirationUnix = result.Expiration
+	return saveChannelState(ctx, stateURI, channel)
+}
+
+// syncChanges lists everything new since the stored page token, publishes
+// one Pub/Sub message per relevant file, and advances the stored token.
+func syncChanges(ctx context.Context, driveService *drive.Service) error {
+	stateMu.Lock()
+	pageToken := channel.PageToken
+	stateMu.Unlock()
 
-		// Check if the file is new (created or modified within the last five seconds)
-		createdTime, err := time.Parse(time.RFC3339, file.CreatedTime)
+	newPageToken, changes, err := listChanges(ctx, driveService, pageToken, folderID, driveID, allowedMimeTypes, seenSince)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		fileInfo := FileInfo{
+			FileName:   change.Name,
+			ResourceID: change.FileID,
+		}
+		fileInfoBytes, err := json.Marshal(fileInfo)
 		if err != nil {
-			log.Printf("Error parsing created time: %v", err)
+			log.Printf("Error marshaling file info: %v", err)
 			continue
 		}
 
-		modifiedTime, err := time.Parse(time.RFC3339, file.ModifiedTime)
+		result := topic.Publish(ctx, &pubsub.Message{Data: fileInfoBytes})
+		id, err := result.Get(ctx)
 		if err != nil {
-			log.Printf("Error parsing modified time: %v", err)
+			log.Printf("Failed to publish message: %v", err)
 			continue
 		}
-
-		if time.Since(createdTime) <= 5*time.Second || time.Since(modifiedTime) <= 5*time.Second {
-			// Check if the file is a Word document
-			// if file.MimeType == "application/vnd.openxmlformats-officedocument.wordprocessingml.document" || file.MimeType == "application/msword" {
-			log.Printf("File ID: %s, Name: %s, Created Time: %s, Modified Time: %s is a new or modified file!!!", file.Id, file.Name, file.CreatedTime, file.ModifiedTime)
-			fileInfo := FileInfo{
-				FileName:   file.Name,
-				ResourceID: file.Id,
-			}
-
-			// Publish the file information to the Pub/Sub topic
-			fileInfoBytes, err := json.Marshal(fileInfo)
-			if err != nil {
-				log.Printf("Error marshaling file info: %v", err)
-				continue
-			}
-
-			result := topic.Publish(ctx, &pubsub.Message{
-				Data: fileInfoBytes,
-			})
-
-			// Block until the result is returned and log server-generated message IDs.
-			id, err := result.Get(ctx)
-			if err != nil {
-				log.Printf("Failed to publish message: %v", err)
-			}
-			log.Printf("Published message with ID: %s for file: %s", id, file.Name)
-
-			// } else {
-			// 	log.Printf("File ID: %s, Name: %s is not a Word document, ignoring.", file.Id, file.Name)
-			// }
-		}
+		log.Printf("Published message with ID: %s for file: %s", id, change.Name)
 	}
+
+	stateMu.Lock()
+	channel.PageToken = newPageToken
+	err = saveChannelState(ctx, stateURI, channel)
+	stateMu.Unlock()
+	return err
 }
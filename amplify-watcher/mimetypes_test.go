@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestParseAllowedMimeTypes(t *testing.T) {
+	if set := parseAllowedMimeTypes(""); set != nil {
+		t.Fatalf("expected nil set for empty input, got %v", set)
+	}
+
+	set := parseAllowedMimeTypes("docx, pdf ,application/vnd.google-apps.spreadsheet")
+	want := []string{
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/pdf",
+		"application/vnd.google-apps.spreadsheet",
+	}
+	for _, mimeType := range want {
+		if !set[mimeType] {
+			t.Errorf("expected %q to be in the parsed set", mimeType)
+		}
+	}
+	if len(set) != len(want) {
+		t.Errorf("got %d entries, want %d", len(set), len(want))
+	}
+}
+
+func TestMimeAllowed(t *testing.T) {
+	if !mimeAllowed(nil, "anything/at-all") {
+		t.Error("nil filter should allow everything")
+	}
+
+	set := parseAllowedMimeTypes("docx,pdf")
+	if !mimeAllowed(set, "application/pdf") {
+		t.Error("expected application/pdf to be allowed")
+	}
+	if mimeAllowed(set, "image/png") {
+		t.Error("expected image/png to be rejected")
+	}
+}
@@ -0,0 +1,104 @@
+// Package drivepacer provides a shared backoff pacer for Drive API calls,
+// used by both amplify-cloud-function and amplify-watcher so a fix to the
+// backoff/retry predicate only has to be made in one place.
+package drivepacer
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Pacer retries transient Drive API failures with a decaying exponential
+// backoff, modeled on rclone's lib/pacer: start small, back off on
+// failure, decay back down on success.
+type Pacer struct {
+	mu            sync.Mutex
+	minSleep      time.Duration
+	maxSleep      time.Duration
+	decayConstant uint
+	sleepTime     time.Duration
+}
+
+func New() *Pacer {
+	return &Pacer{
+		minSleep:      10 * time.Millisecond,
+		maxSleep:      2 * time.Second,
+		decayConstant: 2,
+		sleepTime:     10 * time.Millisecond,
+	}
+}
+
+// Call invokes fn, retrying with backoff while fn reports retry=true and
+// ctx hasn't been cancelled. fn should return (shouldRetry, err).
+func (p *Pacer) Call(ctx context.Context, name string, fn func() (bool, error)) error {
+	var retries int
+	for {
+		retry, err := fn()
+		if !retry {
+			p.decay()
+			return err
+		}
+
+		retries++
+		sleep := p.grow()
+		log.Printf("%s: retrying after transient error (attempt %d, sleeping %v): %v", name, retries, sleep, err)
+
+		select {
+		case <-time.After(sleep):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (p *Pacer) grow() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sleep := p.sleepTime
+	p.sleepTime *= time.Duration(p.decayConstant)
+	if p.sleepTime > p.maxSleep {
+		p.sleepTime = p.maxSleep
+	}
+	// add jitter so retries from concurrent calls don't synchronize
+	return sleep/2 + time.Duration(rand.Int63n(int64(sleep/2+1)))
+}
+
+func (p *Pacer) decay() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sleepTime /= time.Duration(p.decayConstant)
+	if p.sleepTime < p.minSleep {
+		p.sleepTime = p.minSleep
+	}
+}
+
+// ShouldRetry reports whether err looks like a transient Drive API
+// failure worth retrying: HTTP 429/500/502/503/504, or a 403 whose
+// reason is a rate-limit or backend error.
+func ShouldRetry(err error) bool {
+	if err == nil {
+		return false
+	}
+	apiErr, ok := err.(*googleapi.Error)
+	if !ok {
+		return false
+	}
+	switch apiErr.Code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusForbidden:
+		for _, e := range apiErr.Errors {
+			switch e.Reason {
+			case "userRateLimitExceeded", "rateLimitExceeded", "backendError":
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package drivepacer
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestShouldRetry(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil error", nil, false},
+		{"not a googleapi error", errors.New("boom"), false},
+		{"429", &googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{"503", &googleapi.Error{Code: http.StatusServiceUnavailable}, true},
+		{"403 userRateLimitExceeded", &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}, true},
+		{"403 other reason", &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "insufficientPermissions"}}}, false},
+		{"404", &googleapi.Error{Code: http.StatusNotFound}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ShouldRetry(tc.err); got != tc.want {
+				t.Errorf("ShouldRetry(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}